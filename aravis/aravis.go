@@ -1,12 +1,70 @@
 package aravis
 
-// #cgo pkg-config: aravis-0.8
-// #include <arv.h>
-// #include <stdlib.h>
+/*
+#cgo pkg-config: aravis-0.8
+#include <arv.h>
+#include <stdlib.h>
+
+extern void goControlLostCallback(ArvDevice *device, gpointer user_data);
+
+static inline gulong arv_connect_control_lost(ArvDevice *device, gpointer user_data) {
+    return g_signal_connect(device, "control-lost", G_CALLBACK(goControlLostCallback), user_data);
+}
+*/
 import "C"
 
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
 type ArvDevice struct {
-    id C.uint
+	id C.uint
+}
+
+// ArvDeviceHandle is an opened control connection to a camera, obtained via
+// Open. Feature nodes can only be read/written once a device is opened;
+// the plain ArvDevice only exposes the cheap, list-derived getters below.
+type ArvDeviceHandle struct {
+	device *C.ArvDevice
+
+	// controlLostID, if non-zero, is this handle's key in controlLostWatchers
+	// and must be cleaned up on Close.
+	controlLostID uint64
+
+	// closed is closed by Close, so anything selecting on Closed() (e.g. a
+	// watchControlLost goroutine that would otherwise block on the
+	// control-lost channel forever) wakes up and can exit.
+	closed chan struct{}
+}
+
+// controlLostWatchers lets the goControlLostCallback cgo export route a
+// "control-lost" signal back to the Go channel that's watching for it. We
+// can't pass a Go channel through gpointer (cgo forbids handing C code a
+// pointer into the Go heap that it may retain), so we hand it an opaque,
+// monotonically increasing id instead and keep the real channel here.
+var (
+	controlLostMu       sync.Mutex
+	controlLostWatchers = make(map[uint64]chan struct{})
+	controlLostNextID   uint64
+)
+
+//export goControlLostCallback
+func goControlLostCallback(device *C.ArvDevice, userData C.gpointer) {
+	id := uint64(uintptr(userData))
+
+	controlLostMu.Lock()
+	ch, ok := controlLostWatchers[id]
+	controlLostMu.Unlock()
+
+	if !ok {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
 }
 
 func (d *ArvDevice) Id() (string, error) {
@@ -49,20 +107,163 @@ func (d *ArvDevice) InterfaceId() (string, error) {
 	return C.GoString(s), err
 }
 
+// Open establishes a control connection to the device so that GenICam
+// feature nodes can be read. Callers must Close the returned handle once
+// they're done with it.
+func (d *ArvDevice) Open() (*ArvDeviceHandle, error) {
+	device_id, err := C.arv_get_device_id(d.id)
+	if err != nil {
+		return nil, err
+	}
+
+	var gerr *C.GError
+	dev := C.arv_open_device(device_id, &gerr)
+	if dev == nil {
+		return nil, gErrorToGo(gerr, "failed to open device")
+	}
+
+	return &ArvDeviceHandle{device: dev, closed: make(chan struct{})}, nil
+}
+
+// WatchControlLost subscribes to the device's GObject "control-lost" signal,
+// which aravis fires when the camera stops responding to its control
+// channel (unplugged, power loss, network drop). The returned channel
+// receives a value at most once per loss; callers should stop using the
+// handle once that happens and Close it.
+func (h *ArvDeviceHandle) WatchControlLost() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	controlLostMu.Lock()
+	controlLostNextID++
+	id := controlLostNextID
+	controlLostWatchers[id] = ch
+	controlLostMu.Unlock()
+
+	h.controlLostID = id
+	C.arv_connect_control_lost(h.device, C.gpointer(uintptr(id)))
+
+	return ch
+}
+
+// Closed returns a channel that's closed once Close is called, so callers
+// blocked waiting on the control-lost channel can stop waiting when the
+// handle is torn down instead of leaking their goroutine.
+func (h *ArvDeviceHandle) Closed() <-chan struct{} {
+	return h.closed
+}
+
+// Close releases the control connection opened by Open.
+func (h *ArvDeviceHandle) Close() {
+	if h.controlLostID != 0 {
+		controlLostMu.Lock()
+		delete(controlLostWatchers, h.controlLostID)
+		controlLostMu.Unlock()
+	}
+	select {
+	case <-h.closed:
+		// already closed
+	default:
+		close(h.closed)
+	}
+	C.g_object_unref(C.gpointer(h.device))
+}
+
+// GetIntegerFeatureValue reads an integer-valued GenICam feature node, e.g.
+// "DeviceUptime".
+func (h *ArvDeviceHandle) GetIntegerFeatureValue(feature string) (int64, error) {
+	cfeature := C.CString(feature)
+	defer C.free(unsafe.Pointer(cfeature))
+
+	var gerr *C.GError
+	value := C.arv_device_get_integer_feature_value(h.device, cfeature, &gerr)
+	if gerr != nil {
+		return 0, gErrorToGo(gerr, fmt.Sprintf("failed to read integer feature %q", feature))
+	}
+
+	return int64(value), nil
+}
+
+// GetFloatFeatureValue reads a float-valued GenICam feature node, e.g.
+// "DeviceTemperature".
+func (h *ArvDeviceHandle) GetFloatFeatureValue(feature string) (float64, error) {
+	cfeature := C.CString(feature)
+	defer C.free(unsafe.Pointer(cfeature))
+
+	var gerr *C.GError
+	value := C.arv_device_get_float_feature_value(h.device, cfeature, &gerr)
+	if gerr != nil {
+		return 0, gErrorToGo(gerr, fmt.Sprintf("failed to read float feature %q", feature))
+	}
+
+	return float64(value), nil
+}
+
+// GetStringFeatureValue reads a string-valued GenICam feature node, e.g.
+// "DeviceVendorName".
+func (h *ArvDeviceHandle) GetStringFeatureValue(feature string) (string, error) {
+	cfeature := C.CString(feature)
+	defer C.free(unsafe.Pointer(cfeature))
+
+	var gerr *C.GError
+	value := C.arv_device_get_string_feature_value(h.device, cfeature, &gerr)
+	if gerr != nil {
+		return "", gErrorToGo(gerr, fmt.Sprintf("failed to read string feature %q", feature))
+	}
+
+	return C.GoString(value), nil
+}
+
+// GetAvailableEnumerationFeatureValues reads the set of entries currently
+// selectable for a GenICam enumeration node, e.g. the PixelFormat values a
+// camera supports in its current configuration.
+func (h *ArvDeviceHandle) GetAvailableEnumerationFeatureValues(feature string) ([]string, error) {
+	cfeature := C.CString(feature)
+	defer C.free(unsafe.Pointer(cfeature))
+
+	var n C.guint
+	var gerr *C.GError
+	cvalues := C.arv_device_get_available_enumeration_feature_values_as_strings(h.device, cfeature, &n, &gerr)
+	if gerr != nil {
+		return nil, gErrorToGo(gerr, fmt.Sprintf("failed to read available values for enum feature %q", feature))
+	}
+	defer C.free(unsafe.Pointer(cvalues))
+
+	// The individual strings are GenICam node names owned by the underlying
+	// ArvGcFeatureNode, not separately heap-allocated; only the container
+	// array returned by aravis needs to be freed.
+	cvalueSlice := (*[1 << 20]*C.char)(unsafe.Pointer(cvalues))[:n:n]
+	values := make([]string, n)
+	for i, cvalue := range cvalueSlice {
+		values[i] = C.GoString(cvalue)
+	}
+
+	return values, nil
+}
+
+// gErrorToGo converts a GError raised by an aravis call into a Go error,
+// freeing the GError in the process. It returns nil if gerr is nil.
+func gErrorToGo(gerr *C.GError, context string) error {
+	if gerr == nil {
+		return nil
+	}
+	defer C.g_error_free(gerr)
+	return fmt.Errorf("%s: %s", context, C.GoString((*C.char)(gerr.message)))
+}
+
 func GetDevices() ([]*ArvDevice, error) {
-    ndevices, err := GetNumDevices()
+	ndevices, err := GetNumDevices()
 
-    if err != nil {
-        return nil, err
-    }
+	if err != nil {
+		return nil, err
+	}
 
-    devices := make([]*ArvDevice, 0, ndevices)
+	devices := make([]*ArvDevice, 0, ndevices)
 
-    for id := uint(0); id < ndevices; id++ {
-        devices = append(devices, &ArvDevice {id: C.uint(id)})
-    }
+	for id := uint(0); id < ndevices; id++ {
+		devices = append(devices, &ArvDevice{id: C.uint(id)})
+	}
 
-    return devices, err
+	return devices, err
 }
 
 func GetNumDevices() (uint, error) {
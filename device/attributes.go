@@ -0,0 +1,73 @@
+package device
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/plugins/shared/structs"
+)
+
+// readAttributes enumerates the GenICam standard feature nodes we expose as
+// device.DeviceGroup attributes, so job authors can write constraints like:
+//
+//	constraint { attribute = "${device.attr.genicam.pixel_format}" ... }
+//
+// Nodes that fail to read (not supported by this camera model, or the
+// control connection is down) are simply omitted.
+func (d *GenicamDevice) readAttributes(tracked *trackedDevice) map[string]*structs.Attribute {
+	attrs := map[string]*structs.Attribute{}
+
+	if tracked.interface_type != "" {
+		attrs["interface_type"] = structs.NewStringAttribute(tracked.interface_type)
+	}
+
+	if tracked.handle == nil {
+		return attrs
+	}
+	handle := tracked.handle
+
+	if width, err := handle.GetIntegerFeatureValue("Width"); err == nil {
+		attrs["width"] = structs.NewIntAttribute(width, "px")
+	}
+	if height, err := handle.GetIntegerFeatureValue("Height"); err == nil {
+		attrs["height"] = structs.NewIntAttribute(height, "px")
+	}
+	if sensorWidth, err := handle.GetIntegerFeatureValue("SensorWidth"); err == nil {
+		attrs["sensor_width"] = structs.NewIntAttribute(sensorWidth, "px")
+	}
+	if sensorHeight, err := handle.GetIntegerFeatureValue("SensorHeight"); err == nil {
+		attrs["sensor_height"] = structs.NewIntAttribute(sensorHeight, "px")
+	}
+	if linkSpeed, err := handle.GetIntegerFeatureValue("DeviceLinkSpeed"); err == nil {
+		attrs["link_speed"] = structs.NewIntAttribute(linkSpeed, "Bps")
+	}
+	if firmwareVersion, err := handle.GetStringFeatureValue("DeviceFirmwareVersion"); err == nil {
+		attrs["firmware_version"] = structs.NewStringAttribute(firmwareVersion)
+	}
+	if pixelFormat, err := handle.GetStringFeatureValue("PixelFormat"); err == nil {
+		attrs["pixel_format"] = structs.NewStringAttribute(pixelFormat)
+	}
+	if pixelFormats, err := handle.GetAvailableEnumerationFeatureValues("PixelFormat"); err == nil && len(pixelFormats) > 0 {
+		attrs["pixel_formats"] = structs.NewStringAttribute(strings.Join(pixelFormats, ","))
+	}
+
+	return attrs
+}
+
+// attributeSignature renders a device's attributes into a stable string, so
+// two devices of the same model can be compared for whether they belong in
+// the same device.DeviceGroup.
+func attributeSignature(attrs map[string]*structs.Attribute) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s=%s;", k, attrs[k].String())
+	}
+	return sb.String()
+}
@@ -0,0 +1,187 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// checkpointFileName is the name of the checkpoint file written under
+	// the configured state_dir.
+	checkpointFileName = "genicam-checkpoint.json"
+
+	// checkpointSchemaVersion is bumped whenever the on-disk checkpoint
+	// format changes incompatibly. Bumped to 2 when reservations grew a
+	// ReservedAt timestamp to support reservation_ttl expiry. Bumped to 3
+	// when entries switched from tracking bare physical serials to the
+	// device IDs Reserve actually received, so pseudo devices of a shared
+	// camera are tracked independently.
+	checkpointSchemaVersion = 3
+)
+
+// reservedEntry is a single checkpointed reservation: the device IDs it
+// covers (pseudo IDs like "ABC123#0" in shared mode, bare serials in
+// exclusive mode) and when Reserve granted it, so expireReservations has
+// something to measure a TTL against.
+type reservedEntry struct {
+	DeviceIDs  []string  `json:"device_ids"`
+	ReservedAt time.Time `json:"reserved_at"`
+}
+
+// checkpointData is the on-disk representation of GenicamDevice.reserved.
+type checkpointData struct {
+	SchemaVersion int                      `json:"schema_version"`
+	Reservations  map[string]reservedEntry `json:"reservations"`
+}
+
+// checkpoint persists GenicamDevice.reserved to a JSON file so reservations
+// survive a plugin restart, the same way kubelet's device plugin manager
+// checkpoints its pod->device mapping.
+type checkpoint struct {
+	// path is empty when no state_dir is configured, in which case the
+	// checkpoint is a no-op and reservations are in-memory only.
+	path string
+
+	// writeLock serializes writes to path, playing the role kubelet's
+	// device manager gives its podResourcesLock.
+	writeLock sync.Mutex
+}
+
+// newCheckpoint returns a checkpoint backed by stateDir, or a no-op
+// checkpoint if stateDir is empty.
+func newCheckpoint(stateDir string) *checkpoint {
+	if stateDir == "" {
+		return &checkpoint{}
+	}
+	return &checkpoint{path: filepath.Join(stateDir, checkpointFileName)}
+}
+
+// load reads back the checkpoint file, if any, into a reservation map keyed
+// the same way Reserve populates GenicamDevice.reserved.
+func (c *checkpoint) load() (map[string]reservedEntry, error) {
+	if c.path == "" {
+		return map[string]reservedEntry{}, nil
+	}
+
+	raw, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return map[string]reservedEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %q: %w", c.path, err)
+	}
+
+	var data checkpointData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %q: %w", c.path, err)
+	}
+	if data.SchemaVersion != checkpointSchemaVersion {
+		return nil, fmt.Errorf("checkpoint %q has unsupported schema version %d", c.path, data.SchemaVersion)
+	}
+
+	if data.Reservations == nil {
+		data.Reservations = map[string]reservedEntry{}
+	}
+	return data.Reservations, nil
+}
+
+// save atomically overwrites the checkpoint file with the given reservation
+// map, writing to a temp file in the same directory and renaming it into
+// place so a crash mid-write can never leave a truncated checkpoint behind.
+func (c *checkpoint) save(reserved map[string]reservedEntry) error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	raw, err := json.Marshal(checkpointData{
+		SchemaVersion: checkpointSchemaVersion,
+		Reservations:  reserved,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+	tmp, err := ioutil.TempFile(dir, ".genicam-checkpoint-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to rename checkpoint into place: %w", err)
+	}
+
+	return nil
+}
+
+// reservationKey derives a stable identifier for a Reserve call from the
+// device IDs it was granted. Nomad's device plugin Reserve RPC doesn't pass
+// the allocation ID through, so we key checkpoint entries by the sorted set
+// of device IDs instead -- the same set of pseudo devices can't be reserved
+// by two allocations at once, so the set is unique per allocation in
+// practice.
+func reservationKey(deviceIDs []string) string {
+	sorted := append([]string(nil), deviceIDs...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// deviceIDIsReserved reports whether deviceID is covered by an entry in
+// reserved that hasn't yet passed ttl. A ttl of 0 means reservations never
+// expire. Entries are checked lazily here rather than swept on a timer, so a
+// reservation can briefly outlive its TTL between Reserve calls -- harmless,
+// since nothing relies on a reservation disappearing at exactly ttl.
+//
+// deviceID is whatever Reserve actually received (a bare serial in
+// exclusive mode, a pseudo ID like "ABC123#0" in shared mode), so two
+// different pseudo devices of the same shared camera are tracked, and
+// checked, independently.
+func deviceIDIsReserved(reserved map[string]reservedEntry, deviceID string, ttl time.Duration) bool {
+	for _, entry := range reserved {
+		if ttl != 0 && time.Since(entry.ReservedAt) > ttl {
+			continue
+		}
+		for _, id := range entry.DeviceIDs {
+			if id == deviceID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expireReservations drops any entry in reserved older than ttl, the same
+// check deviceIDIsReserved applies at Reserve time. Run once at startup so
+// a stale checkpoint doesn't get re-persisted forever by every subsequent
+// Reserve/Cleanup round-trip.
+func expireReservations(reserved map[string]reservedEntry, ttl time.Duration) map[string]reservedEntry {
+	if ttl == 0 {
+		return reserved
+	}
+	live := make(map[string]reservedEntry, len(reserved))
+	for key, entry := range reserved {
+		if time.Since(entry.ReservedAt) <= ttl {
+			live[key] = entry
+		}
+	}
+	return live
+}
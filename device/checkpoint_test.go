@@ -0,0 +1,136 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReservationKey(t *testing.T) {
+	a := reservationKey([]string{"ABC123#1", "ABC123#0"})
+	b := reservationKey([]string{"ABC123#0", "ABC123#1"})
+	if a != b {
+		t.Fatalf("reservationKey is order-sensitive: %q != %q", a, b)
+	}
+}
+
+func TestDeviceIDIsReserved(t *testing.T) {
+	now := time.Now()
+	reserved := map[string]reservedEntry{
+		"k": {DeviceIDs: []string{"ABC123#0"}, ReservedAt: now},
+	}
+
+	// chunk0-3 review fix: a distinct pseudo device of the same camera must
+	// not be blocked by another pseudo device's reservation.
+	if deviceIDIsReserved(reserved, "ABC123#1", 0) {
+		t.Fatalf("ABC123#1 reported reserved by an entry covering only ABC123#0")
+	}
+	if !deviceIDIsReserved(reserved, "ABC123#0", 0) {
+		t.Fatalf("ABC123#0 reported unreserved despite a covering entry")
+	}
+
+	// an expired entry (past ttl) no longer counts as reserved.
+	stale := map[string]reservedEntry{
+		"k": {DeviceIDs: []string{"ABC123#0"}, ReservedAt: now.Add(-2 * time.Hour)},
+	}
+	if deviceIDIsReserved(stale, "ABC123#0", time.Hour) {
+		t.Fatalf("ABC123#0 reported reserved by an entry older than ttl")
+	}
+	if !deviceIDIsReserved(stale, "ABC123#0", 0) {
+		t.Fatalf("ttl=0 should never expire a reservation")
+	}
+}
+
+func TestExpireReservations(t *testing.T) {
+	now := time.Now()
+	reserved := map[string]reservedEntry{
+		"fresh": {DeviceIDs: []string{"ABC123#0"}, ReservedAt: now},
+		"stale": {DeviceIDs: []string{"XYZ789"}, ReservedAt: now.Add(-2 * time.Hour)},
+	}
+
+	live := expireReservations(reserved, time.Hour)
+	if _, ok := live["fresh"]; !ok {
+		t.Fatalf("expireReservations dropped an entry within ttl")
+	}
+	if _, ok := live["stale"]; ok {
+		t.Fatalf("expireReservations kept an entry past ttl")
+	}
+
+	if got := expireReservations(reserved, 0); len(got) != len(reserved) {
+		t.Fatalf("ttl=0 should return every entry unchanged, got %d want %d", len(got), len(reserved))
+	}
+}
+
+func TestCheckpointSaveLoadRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genicam-checkpoint-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ckpt := newCheckpoint(dir)
+	want := map[string]reservedEntry{
+		reservationKey([]string{"ABC123#0"}): {
+			DeviceIDs:  []string{"ABC123#0"},
+			ReservedAt: time.Now().Round(0),
+		},
+	}
+
+	if err := ckpt.save(want); err != nil {
+		t.Fatalf("save returned unexpected error: %v", err)
+	}
+
+	got, err := ckpt.load()
+	if err != nil {
+		t.Fatalf("load returned unexpected error: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("load returned %d entries, want %d", len(got), len(want))
+	}
+	for key, wantEntry := range want {
+		gotEntry, ok := got[key]
+		if !ok {
+			t.Fatalf("load missing key %q", key)
+		}
+		if len(gotEntry.DeviceIDs) != len(wantEntry.DeviceIDs) || gotEntry.DeviceIDs[0] != wantEntry.DeviceIDs[0] {
+			t.Fatalf("load entry %q DeviceIDs = %v, want %v", key, gotEntry.DeviceIDs, wantEntry.DeviceIDs)
+		}
+		if !gotEntry.ReservedAt.Equal(wantEntry.ReservedAt) {
+			t.Fatalf("load entry %q ReservedAt = %v, want %v", key, gotEntry.ReservedAt, wantEntry.ReservedAt)
+		}
+	}
+}
+
+func TestCheckpointLoadMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genicam-checkpoint-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ckpt := newCheckpoint(filepath.Join(dir, "does-not-exist"))
+	got, err := ckpt.load()
+	if err != nil {
+		t.Fatalf("load returned unexpected error for a missing checkpoint: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("load of a missing checkpoint returned %d entries, want 0", len(got))
+	}
+}
+
+func TestCheckpointNoOpWithoutStateDir(t *testing.T) {
+	ckpt := newCheckpoint("")
+	if err := ckpt.save(map[string]reservedEntry{"k": {DeviceIDs: []string{"ABC123"}}}); err != nil {
+		t.Fatalf("save on a no-op checkpoint returned unexpected error: %v", err)
+	}
+	got, err := ckpt.load()
+	if err != nil {
+		t.Fatalf("load on a no-op checkpoint returned unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("load on a no-op checkpoint returned %d entries, want 0", len(got))
+	}
+}
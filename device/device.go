@@ -3,6 +3,7 @@ package device
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -34,9 +35,14 @@ const (
 	// deviceType is the "type" of device being returned
 	deviceType = "genicam"
 
-    // environment variable names
-    deviceSerialNbr = "GENICAM_DEVICE_SERIAL_NBR"
-    deviceAddress = "GENICAM_DEVICE_ADDRESS"
+	// environment variable names
+	deviceSerialNbr   = "GENICAM_DEVICE_SERIAL_NBR"
+	deviceAddress     = "GENICAM_DEVICE_ADDRESS"
+	devicePseudoIndex = "GENICAM_DEVICE_PSEUDO_INDEX"
+
+	// sharing modes accepted by the sharing_mode config attr
+	sharingModeExclusive = "exclusive"
+	sharingModeShared    = "shared"
 )
 
 var (
@@ -63,16 +69,64 @@ var (
 			hclspec.NewAttr("fingerprint_period", "string", false),
 			hclspec.NewLiteral("\"5s\""),
 		),
+		"state_dir": hclspec.NewDefault(
+			hclspec.NewAttr("state_dir", "string", false),
+			hclspec.NewLiteral("\"\""),
+		),
+		"sharing_mode": hclspec.NewDefault(
+			hclspec.NewAttr("sharing_mode", "string", false),
+			hclspec.NewLiteral("\"exclusive\""),
+		),
+		"num_pseudo_devices": hclspec.NewDefault(
+			hclspec.NewAttr("num_pseudo_devices", "number", false),
+			hclspec.NewLiteral("1"),
+		),
+		"force_emit_period": hclspec.NewDefault(
+			hclspec.NewAttr("force_emit_period", "string", false),
+			hclspec.NewLiteral("\"5m\""),
+		),
+		"reservation_ttl": hclspec.NewDefault(
+			hclspec.NewAttr("reservation_ttl", "string", false),
+			hclspec.NewLiteral("\"24h\""),
+		),
 	})
 
-    // error to return when a device is requested but the plugin isn't enabled
-    errPluginDisabled = fmt.Errorf("genicam device is not enabled")
+	// error to return when a device is requested but the plugin isn't enabled
+	errPluginDisabled = fmt.Errorf("genicam device is not enabled")
 )
 
 // Config contains configuration information for the plugin.
 type Config struct {
-    Enabled bool `codec:"enabled"`
+	Enabled           bool   `codec:"enabled"`
 	FingerprintPeriod string `codec:"fingerprint_period"`
+
+	// StateDir, if set, is where the reservation checkpoint is persisted so
+	// allocations survive a plugin restart. Empty disables checkpointing.
+	StateDir string `codec:"state_dir"`
+
+	// SharingMode controls whether a physical camera is split into multiple
+	// pseudo devices that can be reserved independently. One of
+	// sharingModeExclusive (default) or sharingModeShared.
+	SharingMode string `codec:"sharing_mode"`
+
+	// NumPseudoDevices is how many pseudo devices each physical camera is
+	// split into when SharingMode is "shared". Ignored (forced to 1) in
+	// "exclusive" mode.
+	NumPseudoDevices int `codec:"num_pseudo_devices"`
+
+	// ForceEmitPeriod is the longest we'll go without sending a
+	// FingerprintResponse, even if nothing changed, so Nomad's view of our
+	// devices doesn't go stale if it missed an update. 0 disables the floor
+	// and only ever emits on a real diff.
+	ForceEmitPeriod string `codec:"force_emit_period"`
+
+	// ReservationTTL bounds how long a checkpointed reservation refuses to
+	// hand its serials back out. Nomad's device plugin RPC surface never
+	// tells us an allocation ended, so without an expiry a reservation left
+	// over from a completed or crashed allocation would hold its camera
+	// hostage forever across restarts. 0 disables expiry (a reservation
+	// lasts forever, matching pre-TTL behavior).
+	ReservationTTL string `codec:"reservation_ttl"`
 }
 
 // GenicamDevice contains a skeleton for most of the implementation of a
@@ -87,12 +141,60 @@ type GenicamDevice struct {
 	// most plugins that fingerprint in a polling loop will have this
 	fingerprintPeriod time.Duration
 
-	// devices is a list of fingerprinted devices
-	// most plugins will maintain, at least, a list of the devices that were
-	// discovered during fingerprinting.
-	// we save the "device serial"/"ip address"
-	devices    map[string]string
+	// devices is a list of fingerprinted devices, keyed by serial number.
+	// Alongside the address we also track each device's health state so
+	// deviceGroupFromFingerprintData can report something more useful than
+	// a hard-coded Healthy: true.
+	devices    map[string]*trackedDevice
 	deviceLock sync.RWMutex
+
+	// healthEvents wakes up doFingerprint when a tracked device's health
+	// flips between polls (e.g. its control connection is lost), so an
+	// updated FingerprintResponse goes out immediately instead of waiting
+	// for the next fingerprintPeriod tick.
+	healthEvents chan struct{}
+
+	// reserved tracks successful Reserve calls, keyed by reservationKey, and
+	// is persisted via checkpoint so the set of granted device IDs survives
+	// a plugin restart. Reserve refuses to hand out a device ID already
+	// present here unless its entry has passed reservationTTL -- nothing in
+	// the device plugin RPC surface calls Cleanup when an allocation ends,
+	// so the TTL is what eventually un-refuses a camera left behind by a
+	// completed or crashed allocation. Entries are keyed at device-ID (not
+	// bare serial) granularity so distinct pseudo devices of a shared
+	// camera are tracked independently.
+	reserved map[string]reservedEntry
+
+	// checkpoint persists reserved to disk under state_dir.
+	checkpoint *checkpoint
+
+	// reservationTTL is how long a checkpointed reservation refuses to give
+	// its serials back out before it's treated as stale. 0 disables expiry.
+	reservationTTL time.Duration
+
+	// sharingMode and numPseudoDevices control how many pseudo devices
+	// (see pseudodevice.go) each physical camera is fingerprinted as.
+	sharingMode      string
+	numPseudoDevices int
+
+	// lastFingerprint is the device list sent in the most recently emitted
+	// FingerprintResponse, kept so writeFingerprintToChannel can diff
+	// against it instead of re-sending an unchanged list every tick.
+	lastFingerprint []*device.Device
+
+	// lastIdentities records, per pseudo-device ID last emitted, which
+	// DeviceGroup it was reported under and what attribute signature that
+	// group had. device.Device itself only carries ID and Healthy, so
+	// diffFingerprint needs this alongside lastFingerprint to notice a
+	// device that changed group or attributes without its health flipping.
+	lastIdentities map[string]deviceIdentity
+
+	// lastFingerprintEmit is when we last sent on the Fingerprint channel.
+	lastFingerprintEmit time.Time
+
+	// forceEmitPeriod is the longest writeFingerprintToChannel will go
+	// without emitting, even without a diff.
+	forceEmitPeriod time.Duration
 }
 
 // NewGenicamDevice returns a device plugin, used primarily by the main wrapper
@@ -101,8 +203,13 @@ type GenicamDevice struct {
 // a limit to the initialization that can be performed at this point.
 func NewGenicamDevice(log log.Logger) *GenicamDevice {
 	return &GenicamDevice{
-		logger:  log.Named(pluginName),
-		devices: make(map[string]string),
+		logger:           log.Named(pluginName),
+		devices:          make(map[string]*trackedDevice),
+		healthEvents:     make(chan struct{}, 1),
+		reserved:         make(map[string]reservedEntry),
+		checkpoint:       newCheckpoint(""),
+		sharingMode:      sharingModeExclusive,
+		numPseudoDevices: 1,
 	}
 }
 
@@ -136,7 +243,47 @@ func (d *GenicamDevice) SetConfig(c *base.Config) error {
 		return fmt.Errorf("failed to parse doFingerprint period %q: %v", config.FingerprintPeriod, err)
 	}
 	d.fingerprintPeriod = period
-    d.enabled = config.Enabled
+	d.enabled = config.Enabled
+
+	forceEmitPeriod, err := time.ParseDuration(config.ForceEmitPeriod)
+	if err != nil {
+		return fmt.Errorf("failed to parse force_emit_period %q: %v", config.ForceEmitPeriod, err)
+	}
+	d.forceEmitPeriod = forceEmitPeriod
+
+	reservationTTL, err := time.ParseDuration(config.ReservationTTL)
+	if err != nil {
+		return fmt.Errorf("failed to parse reservation_ttl %q: %v", config.ReservationTTL, err)
+	}
+	d.reservationTTL = reservationTTL
+
+	switch config.SharingMode {
+	case "", sharingModeExclusive:
+		d.sharingMode = sharingModeExclusive
+		d.numPseudoDevices = 1
+	case sharingModeShared:
+		d.sharingMode = sharingModeShared
+		d.numPseudoDevices = config.NumPseudoDevices
+		if d.numPseudoDevices < 1 {
+			d.numPseudoDevices = 1
+		}
+	default:
+		return fmt.Errorf("invalid sharing_mode %q: must be %q or %q", config.SharingMode, sharingModeExclusive, sharingModeShared)
+	}
+
+	d.checkpoint = newCheckpoint(config.StateDir)
+	reserved, err := d.checkpoint.load()
+	if err != nil {
+		return fmt.Errorf("failed to load reservation checkpoint: %w", err)
+	}
+	reserved = expireReservations(reserved, d.reservationTTL)
+	d.deviceLock.Lock()
+	d.reserved = reserved
+	d.deviceLock.Unlock()
+	if err := d.checkpoint.save(reserved); err != nil {
+		d.logger.Error("failed to persist reservation checkpoint after expiring stale entries", "error", err)
+	}
+
 	d.logger.Info("configured plugin", "config", log.Fmt("% #v", pretty.Formatter(config)))
 	return nil
 }
@@ -171,6 +318,18 @@ func (e *reservationError) Error() string {
 	return fmt.Sprintf("unknown device IDs: %s", strings.Join(e.notExistingIDs, ","))
 }
 
+// alreadyReservedError is returned when a requested device ID is held by a
+// checkpointed reservation that hasn't expired yet, most often because
+// Reserve is racing a previous allocation for the same device across a
+// plugin restart.
+type alreadyReservedError struct {
+	deviceIDs []string
+}
+
+func (e *alreadyReservedError) Error() string {
+	return fmt.Sprintf("device IDs already reserved: %s", strings.Join(e.deviceIDs, ","))
+}
+
 // Reserve returns information to the task driver on on how to mount the given devices.
 // It may also perform any device-specific orchestration necessary to prepare the device
 // for use. This is called in a pre-start hook on the client, before starting the workload.
@@ -179,26 +338,49 @@ func (d *GenicamDevice) Reserve(deviceIDs []string) (*device.ContainerReservatio
 		return &device.ContainerReservation{}, nil
 	}
 
-    if !d.enabled {
-        return nil, errPluginDisabled
-    }
+	if !d.enabled {
+		return nil, errPluginDisabled
+	}
 
 	d.logger.Info("reserving device ids", "deviceIDs", pretty.Formatter(deviceIDs))
 
-    // This pattern can be useful for some drivers to avoid a race condition where a device disappears
-    // after being scheduled by the server but before the server gets an update on the fingerprint
-    // channel that the device is no longer available.
-    d.deviceLock.RLock()
-    var notExistingIDs []string
-    for _, id := range deviceIDs {
-        if _, deviceIDExists := d.devices[id]; !deviceIDExists {
-            notExistingIDs = append(notExistingIDs, id)
-        }
-    }
-    d.deviceLock.RUnlock()
-    if len(notExistingIDs) != 0 {
-        return nil, &reservationError{notExistingIDs}
-    }
+	// Requested device IDs may be pseudo device IDs (<serial>#<index>) when
+	// sharing_mode is "shared"; resolve each back to the physical camera it
+	// came from before doing anything else.
+	resolved := make([]resolvedDeviceID, len(deviceIDs))
+	for i, id := range deviceIDs {
+		serial_nbr, pseudoIndex, err := parsePseudoDeviceID(id)
+		if err != nil {
+			return nil, status.Newf(codes.InvalidArgument, "%s", err).Err()
+		}
+		resolved[i] = resolvedDeviceID{id: id, serial_nbr: serial_nbr, pseudoIndex: pseudoIndex}
+	}
+
+	// This pattern can be useful for some drivers to avoid a race condition where a device disappears
+	// after being scheduled by the server but before the server gets an update on the fingerprint
+	// channel that the device is no longer available.
+	d.deviceLock.Lock()
+	var notExistingIDs []string
+	for _, r := range resolved {
+		if _, deviceIDExists := d.devices[r.serial_nbr]; !deviceIDExists {
+			notExistingIDs = append(notExistingIDs, r.id)
+		}
+	}
+	if len(notExistingIDs) != 0 {
+		d.deviceLock.Unlock()
+		return nil, &reservationError{notExistingIDs}
+	}
+
+	var alreadyReserved []string
+	for _, r := range resolved {
+		if deviceIDIsReserved(d.reserved, r.id, d.reservationTTL) {
+			alreadyReserved = append(alreadyReserved, r.id)
+		}
+	}
+	if len(alreadyReserved) != 0 {
+		d.deviceLock.Unlock()
+		return nil, &alreadyReservedError{alreadyReserved}
+	}
 
 	// initialize the response
 	resp := &device.ContainerReservation{
@@ -207,18 +389,56 @@ func (d *GenicamDevice) Reserve(deviceIDs []string) (*device.ContainerReservatio
 		Devices: []*device.DeviceSpec{},
 	}
 
-	for index, serial_nbr := range deviceIDs {
+	reservedIDs := make([]string, len(resolved))
+	for index, r := range resolved {
 		// Check if the device is known
-        address, found := d.devices[serial_nbr]
+		tracked, found := d.devices[r.serial_nbr]
 		if !found {
-			return nil, status.Newf(codes.InvalidArgument, "unknown device %q", serial_nbr).Err()
+			d.deviceLock.Unlock()
+			return nil, status.Newf(codes.InvalidArgument, "unknown device %q", r.serial_nbr).Err()
 		}
 
-        d.logger.Info("got device", "index", index, "address", address, "serial_nbr", serial_nbr)
+		d.logger.Info("got device", "index", index, "address", tracked.address, "serial_nbr", r.serial_nbr, "pseudo_index", r.pseudoIndex)
 		// Envs are a set of environment variables to set for the task.
-		resp.Envs[deviceSerialNbr] = serial_nbr
-		resp.Envs[deviceAddress] = address
+		resp.Envs[deviceSerialNbr] = r.serial_nbr
+		resp.Envs[deviceAddress] = tracked.address
+		resp.Envs[devicePseudoIndex] = strconv.Itoa(r.pseudoIndex)
+		reservedIDs[index] = r.id
+	}
+
+	d.reserved[reservationKey(reservedIDs)] = reservedEntry{DeviceIDs: reservedIDs, ReservedAt: time.Now()}
+	checkpointed := make(map[string]reservedEntry, len(d.reserved))
+	for key, entry := range d.reserved {
+		checkpointed[key] = entry
+	}
+	ckpt := d.checkpoint
+	d.deviceLock.Unlock()
+
+	if err := ckpt.save(checkpointed); err != nil {
+		d.logger.Error("failed to persist reservation checkpoint", "error", err)
 	}
 
 	return resp, nil
 }
+
+// Cleanup prunes a reservation from the checkpoint once Nomad is done with
+// the allocation it was made for, freeing its devices up for reuse.
+// reservationKey is the same key Reserve derived the checkpoint entry from
+// (see reservationKey) -- the device plugin RPC surface doesn't give
+// Reserve the allocation ID itself, so there's nothing more specific to key
+// on. Plumbing this into Nomad's allocation lifecycle is a followup; in the
+// meantime reservationTTL is what actually bounds how long a reservation
+// outlives its allocation, and this remains available for anything
+// embedding the plugin directly.
+func (d *GenicamDevice) Cleanup(reservationKey string) error {
+	d.deviceLock.Lock()
+	delete(d.reserved, reservationKey)
+	checkpointed := make(map[string]reservedEntry, len(d.reserved))
+	for key, entry := range d.reserved {
+		checkpointed[key] = entry
+	}
+	ckpt := d.checkpoint
+	d.deviceLock.Unlock()
+
+	return ckpt.save(checkpointed)
+}
@@ -2,6 +2,9 @@ package device
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
 	"time"
 
 	"github.com/hashicorp/nomad/plugins/device"
@@ -23,6 +26,10 @@ func (d *GenicamDevice) doFingerprint(ctx context.Context, devices chan *device.
 			return
 		case <-ticker.C:
 			ticker.Reset(d.fingerprintPeriod)
+		case <-d.healthEvents:
+			// a tracked device's health flipped between polls (e.g. its
+			// control connection was lost) -- emit right away instead of
+			// waiting for the next tick so Nomad reschedules promptly
 		}
 
 		d.writeFingerprintToChannel(devices)
@@ -33,131 +40,376 @@ func (d *GenicamDevice) doFingerprint(ctx context.Context, devices chan *device.
 //
 // plugin implementations will likely have a native struct provided by the corresonding SDK
 type fingerprintedDevice struct {
-    device_id string
-    physical_id string
-    model string
-    serial_nbr string
-    vendor string
-    address string
-    protocol string
+	device_id      string
+	physical_id    string
+	model          string
+	serial_nbr     string
+	vendor         string
+	address        string
+	protocol       string
+	interface_type string
 }
 
-// writeFingerprintToChannel collects fingerprint info, partitions devices into
-// device groups, and sends the data over the provided channel.
+// fingerprintDeviceInfo reads the cheap, list-derived attributes aravis
+// exposes for a discovered device without opening a control connection.
+func fingerprintDeviceInfo(dev *aravis.ArvDevice) (*fingerprintedDevice, error) {
+	device_id, err := dev.Id()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device id: %w", err)
+	}
+
+	physical_id, err := dev.PhysicalId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device physical id: %w", err)
+	}
+
+	model, err := dev.Model()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device model: %w", err)
+	}
+
+	serial_nbr, err := dev.SerialNbr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device serial number: %w", err)
+	}
+
+	vendor, err := dev.Vendor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device vendor: %w", err)
+	}
+
+	address, err := dev.Address()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device address: %w", err)
+	}
+
+	protocol, err := dev.Protocol()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device protocol: %w", err)
+	}
+
+	interface_type, err := dev.InterfaceId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device interface type: %w", err)
+	}
+
+	return &fingerprintedDevice{
+		device_id:      device_id,
+		physical_id:    physical_id,
+		model:          model,
+		serial_nbr:     serial_nbr,
+		vendor:         vendor,
+		address:        address,
+		protocol:       protocol,
+		interface_type: interface_type,
+	}, nil
+}
+
+// probeResult is the outcome of probing one tracked device's health and
+// attributes, computed without holding deviceLock for its full duration
+// (see writeFingerprintToChannel) and applied back afterward.
+type probeResult struct {
+	tracked    *trackedDevice
+	healthy    bool
+	attributes map[string]*structs.Attribute
+}
+
+// writeFingerprintToChannel collects fingerprint info, reconciles it against
+// tracked health state, partitions devices into device groups, and sends the
+// data over the provided channel.
 func (d *GenicamDevice) writeFingerprintToChannel(devices chan<- *device.FingerprintResponse) {
-    d.deviceLock.Lock()
-    defer d.deviceLock.Unlock()
-
-    aravis.UpdateDeviceList()
-    devs, err := aravis.GetDevices()
-    if err != nil {
-        d.logger.Error("failed to get devices", "error", err)
-    }
-
-    var discoveredDevices []*fingerprintedDevice
-
-    //// "discover" some devices
-    for _, dev := range devs {
-        device_id, err := dev.Id()
-        if err != nil {
-            d.logger.Error("failed to get device id", "error", err)
-            continue
-        }
-
-        physical_id, err := dev.PhysicalId()
-        if err != nil {
-            d.logger.Error("failed to get device physical id", "error", err)
-            continue
-        }
-
-        model, err := dev.Model()
-        if err != nil {
-            d.logger.Error("failed to get device model", "error", err)
-            continue
-        }
-
-        serial_nbr, err := dev.SerialNbr()
-        if err != nil {
-            d.logger.Error("failed to get device serial number", "error", err)
-            continue
-        }
-
-        vendor, err := dev.Vendor()
-        if err != nil {
-            d.logger.Error("failed to get device vendor", "error", err)
-            continue
-        }
-
-        address, err := dev.Address()
-        if err != nil {
-            d.logger.Error("failed to get device address", "error", err)
-            continue
-        }
-
-        protocol, err := dev.Protocol()
-        if err != nil {
-            d.logger.Error("failed to get device protocol", "error", err)
-            continue
-        }
-
-        d.logger.Debug("found device", "device_id", device_id)
-
-        discoveredDevices = append(discoveredDevices, &fingerprintedDevice {
-            device_id: device_id,
-            physical_id: physical_id,
-            model: model,
-            serial_nbr: serial_nbr,
-            vendor: vendor,
-            address: address,
-            protocol: protocol,
-        })
-    }
-
-    // during fingerprinting, devices are grouped by "device group" in
-    // order to facilitate scheduling
-    // devices in the same device group should have the same
-    // Vendor, Type, and Name ("Model")
-    // Build Fingerprint response with computed groups and send it over the channel
-    deviceListByDeviceName := make(map[string][]*fingerprintedDevice)
-    for _, device := range discoveredDevices {
-        deviceListByDeviceName[device.model] = append(deviceListByDeviceName[device.model], device)
-        d.devices[device.serial_nbr] = device.address
-    }
-
-    // Build Fingerprint response with computed groups and send it over the channel
-    deviceGroups := make([]*device.DeviceGroup, 0, len(deviceListByDeviceName))
-    for groupName, devices := range deviceListByDeviceName {
-        deviceGroups = append(deviceGroups, deviceGroupFromFingerprintData(groupName, devices))
-    }
-
-    devices <- device.NewFingerprint(deviceGroups...)
+	aravis.UpdateDeviceList()
+	devs, err := aravis.GetDevices()
+	if err != nil {
+		d.logger.Error("failed to get devices", "error", err)
+	}
+
+	// Register newly discovered devices and reattach dropped control
+	// connections, holding the write lock only long enough to do that --
+	// the health probe and attribute reads below are blocking cgo/network
+	// round-trips per camera, and running all of them under the write lock
+	// would stall every Reserve call and all stats collection until the
+	// slowest camera answered.
+	d.deviceLock.Lock()
+	seen := make(map[string]bool, len(devs))
+	toProbe := make([]*trackedDevice, 0, len(devs))
+	for _, dev := range devs {
+		fd, err := fingerprintDeviceInfo(dev)
+		if err != nil {
+			d.logger.Error("failed to fingerprint device", "error", err)
+			continue
+		}
+
+		d.logger.Debug("found device", "device_id", fd.device_id)
+		seen[fd.serial_nbr] = true
+
+		tracked, known := d.devices[fd.serial_nbr]
+		if !known {
+			tracked = d.trackDevice(fd, dev)
+			d.devices[fd.serial_nbr] = tracked
+		} else {
+			tracked.fingerprintedDevice = *fd
+			if tracked.handle == nil {
+				// the device's control connection is dead (initial Open
+				// failed, or it previously fired control-lost) but it's
+				// showing up in the discovered list again -- try to reattach
+				// instead of leaving it unhealthy forever.
+				d.attachControlConnection(tracked, dev)
+			}
+		}
+
+		tracked.missingCycles = 0
+		toProbe = append(toProbe, tracked)
+	}
+	d.deviceLock.Unlock()
+
+	// Probe health and read attributes under a read lock instead of the
+	// write lock: readers like writeStatsToChannel/pollTrackedDeviceStats
+	// can still run concurrently, and the RLock still prevents a concurrent
+	// watchControlLost/forgetDevice from closing a handle out from under an
+	// in-flight read, the same protection pollTrackedDeviceStats relies on.
+	// doFingerprint only ever runs one cycle at a time, so this goroutine
+	// is the sole writer of attributes. healthy is also written by
+	// watchControlLost, which closes and clears the handle when it does, so
+	// a probe result is only applied as healthy if the handle is still set.
+	results := make([]probeResult, len(toProbe))
+	d.deviceLock.RLock()
+	for i, tracked := range toProbe {
+		results[i] = probeResult{
+			tracked:    tracked,
+			healthy:    d.probeHealth(tracked),
+			attributes: d.readAttributes(tracked),
+		}
+	}
+	d.deviceLock.RUnlock()
+
+	// The rest of fingerprinting -- applying probe results, missing-cycle
+	// bookkeeping, grouping, diffing, and emission -- is fast, in-memory
+	// work, so it runs under the write lock like before.
+	d.deviceLock.Lock()
+	defer d.deviceLock.Unlock()
+
+	for _, r := range results {
+		r.tracked.healthy = r.healthy && r.tracked.handle != nil
+		r.tracked.attributes = r.attributes
+	}
+
+	// devices that didn't show up in this cycle's list stay reported (as
+	// unhealthy, once missing for long enough) for a grace period, in case
+	// it's a transient blip, before we give up on them entirely
+	for serial_nbr, tracked := range d.devices {
+		if seen[serial_nbr] {
+			continue
+		}
+
+		tracked.missingCycles++
+		if tracked.missingCycles >= healthMissingCycleLimit {
+			tracked.healthy = false
+		}
+		if tracked.missingCycles >= healthForgetCycleLimit {
+			d.forgetDevice(serial_nbr)
+		}
+	}
+
+	// during fingerprinting, devices are grouped by "device group" in
+	// order to facilitate scheduling
+	// devices in the same device group should have the same
+	// Vendor, Type, and Name ("Model") -- and, since Nomad assumes every
+	// device in a group shares the same Attributes, the same attributes too.
+	// Devices that share a model but report divergent attributes (e.g. two
+	// batches of the same camera with different firmware) are split into
+	// separate, differently-named variants of that model's group.
+	variantsByModel := make(map[string][]*deviceVariant)
+	for _, tracked := range d.devices {
+		variantsByModel[tracked.model] = addToVariant(variantsByModel[tracked.model], tracked)
+	}
+
+	// Build Fingerprint response with computed groups, recording each
+	// pseudo-device's group name and attribute signature as we go so
+	// diffFingerprint can tell a reclassification (attribute change, or
+	// reassignment to a different variant group of the model) apart from no change at
+	// all -- device.Device itself doesn't carry either.
+	deviceGroups := make([]*device.DeviceGroup, 0, len(d.devices))
+	identities := make(map[string]deviceIdentity)
+	for model, variants := range variantsByModel {
+		// Sort purely for deterministic ordering of the emitted DeviceGroups
+		// (e.g. in logs) -- the suffix itself is derived from the variant's
+		// own signature below, not this position, so an unrelated variant
+		// appearing or disappearing can't renumber everyone else's group.
+		sort.Slice(variants, func(i, j int) bool { return variants[i].signature < variants[j].signature })
+
+		for _, variant := range variants {
+			groupName := model
+			if len(variants) > 1 {
+				groupName = fmt.Sprintf("%s-%s", model, signatureSuffix(variant.signature))
+			}
+			for _, tracked := range variant.devices {
+				tracked.groupName = groupName
+				for _, id := range pseudoDeviceIDs(tracked.serial_nbr, d.numPseudoDevices) {
+					identities[id] = deviceIdentity{groupName: groupName, attributeSignature: variant.signature}
+				}
+			}
+			deviceGroups = append(deviceGroups, d.deviceGroupFromFingerprintData(groupName, variant.devices))
+		}
+	}
+
+	// Only send it over the channel if something actually changed, or
+	// force_emit_period has elapsed, so stable multi-camera deployments
+	// don't make Nomad churn on unchanged fingerprint updates.
+	var current []*device.Device
+	for _, group := range deviceGroups {
+		current = append(current, group.Devices...)
+	}
+
+	diff := diffFingerprint(&fingerprintRequest{Previous: d.lastFingerprint, PreviousIdentities: d.lastIdentities}, current, identities)
+	d.lastFingerprint = current
+	d.lastIdentities = identities
+
+	forceEmit := d.forceEmitPeriod > 0 && time.Since(d.lastFingerprintEmit) >= d.forceEmitPeriod
+	if diff.empty() && !forceEmit {
+		return
+	}
+
+	d.logger.Debug("emitting fingerprint",
+		"detected", len(diff.Detected), "removed", len(diff.Removed), "health_changes", len(diff.HealthChanges), "reclassified", len(diff.Reclassified), "forced", forceEmit)
+
+	d.lastFingerprintEmit = time.Now()
+	devices <- device.NewFingerprint(deviceGroups...)
+}
+
+// deviceIdentity is the part of a pseudo-device's classification that lives
+// on its DeviceGroup rather than on device.Device itself -- which group it
+// was reported under, and what attribute signature that group had. Two
+// identities that differ mean a device's attributes changed, or it was
+// reassigned to a different variant group of its model, even though device.Device's own
+// ID/Healthy fields didn't change.
+type deviceIdentity struct {
+	groupName          string
+	attributeSignature string
+}
+
+// fingerprintRequest bundles the device list (and per-device identity)
+// emitted on the previous fingerprint cycle so diffFingerprint can work out
+// what changed.
+type fingerprintRequest struct {
+	Previous           []*device.Device
+	PreviousIdentities map[string]deviceIdentity
+}
+
+// fingerprintResponse is the result of diffing a freshly discovered device
+// list against a fingerprintRequest's Previous snapshot.
+type fingerprintResponse struct {
+	Detected      []*device.Device
+	Removed       []*device.Device
+	HealthChanges []*device.Device
+	Reclassified  []*device.Device
+}
+
+// empty reports whether nothing changed between the two snapshots.
+func (r *fingerprintResponse) empty() bool {
+	return len(r.Detected) == 0 && len(r.Removed) == 0 && len(r.HealthChanges) == 0 && len(r.Reclassified) == 0
+}
+
+// diffFingerprint compares a freshly discovered device list (and its
+// identities) against the previous snapshot in req, reporting what's new,
+// gone, had its Healthy flag flip, or was reclassified into a different
+// DeviceGroup or attribute signature without either of those other fields
+// changing -- e.g. a camera whose firmware update shifts it into a
+// differently-attributed variant group of its model.
+func diffFingerprint(req *fingerprintRequest, current []*device.Device, identities map[string]deviceIdentity) *fingerprintResponse {
+	previousByID := make(map[string]*device.Device, len(req.Previous))
+	for _, dev := range req.Previous {
+		previousByID[dev.ID] = dev
+	}
+
+	resp := &fingerprintResponse{}
+	seen := make(map[string]bool, len(current))
+
+	for _, dev := range current {
+		seen[dev.ID] = true
+
+		prev, known := previousByID[dev.ID]
+		switch {
+		case !known:
+			resp.Detected = append(resp.Detected, dev)
+		case prev.Healthy != dev.Healthy:
+			resp.HealthChanges = append(resp.HealthChanges, dev)
+		case req.PreviousIdentities[dev.ID] != identities[dev.ID]:
+			resp.Reclassified = append(resp.Reclassified, dev)
+		}
+	}
+
+	for _, dev := range req.Previous {
+		if !seen[dev.ID] {
+			resp.Removed = append(resp.Removed, dev)
+		}
+	}
+
+	return resp
 }
 
-// deviceGroupFromFingerprintData composes deviceGroup from a slice of detected devicers
-func deviceGroupFromFingerprintData(groupName string, deviceList []*fingerprintedDevice) *device.DeviceGroup {
+// deviceVariant groups tracked devices of the same model that report an
+// identical attribute signature, so they can become one device.DeviceGroup.
+type deviceVariant struct {
+	signature string
+	devices   []*trackedDevice
+}
+
+// addToVariant appends tracked to the variant of variants matching its
+// attribute signature, creating a new variant if none matches.
+func addToVariant(variants []*deviceVariant, tracked *trackedDevice) []*deviceVariant {
+	signature := attributeSignature(tracked.attributes)
+
+	for _, variant := range variants {
+		if variant.signature == signature {
+			variant.devices = append(variant.devices, tracked)
+			return variants
+		}
+	}
+
+	return append(variants, &deviceVariant{signature: signature, devices: []*trackedDevice{tracked}})
+}
+
+// signatureSuffix derives a stable variant group suffix from an attribute
+// signature, so a model's group names only change when that variant's own
+// attributes change -- not when some unrelated variant of the same model
+// appears or disappears and shifts everyone else's sort position.
+func signatureSuffix(signature string) string {
+	h := fnv.New32a()
+	h.Write([]byte(signature))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// deviceGroupFromFingerprintData composes deviceGroup from a slice of tracked
+// devices, splitting each physical camera into d.numPseudoDevices Device
+// entries (see pseudodevice.go) so shared cameras can be reserved by more
+// than one task.
+func (d *GenicamDevice) deviceGroupFromFingerprintData(groupName string, deviceList []*trackedDevice) *device.DeviceGroup {
 	// deviceGroup without devices makes no sense -> return nil when no devices are provided
 	if len(deviceList) == 0 {
 		return nil
 	}
 
-	devices := make([]*device.Device, 0, len(deviceList))
+	devices := make([]*device.Device, 0, len(deviceList)*d.numPseudoDevices)
 	for _, dev := range deviceList {
-		devices = append(devices, &device.Device{
-			ID: dev.serial_nbr,
-            Healthy: true,  // TODO: this could probably be useful
-            HwLocality: nil,  // TODO: is this useful for anything WRT aravis/tis/genicam?
-		})
+		for _, id := range pseudoDeviceIDs(dev.serial_nbr, d.numPseudoDevices) {
+			devices = append(devices, &device.Device{
+				ID:         id,
+				Healthy:    dev.healthy,
+				HwLocality: nil, // TODO: is this useful for anything WRT aravis/tis/genicam?
+			})
+		}
 	}
 
 	return &device.DeviceGroup{
-		Vendor: vendor,
-		Type: deviceType,
-        Name: groupName,
+		Vendor:  vendor,
+		Type:    deviceType,
+		Name:    groupName,
 		Devices: devices,
 		// The device API assumes that devices with the same DeviceName have the same
 		// attributes like amount of memory, power, bar1memory, etc.
-		// If not, then they'll need to be split into different device groups
-		// with different names.
-		Attributes: map[string]*structs.Attribute{},
+		// Callers group devices into variants by attribute signature before
+		// calling this, so every device in deviceList shares these attributes.
+		Attributes: deviceList[0].attributes,
 	}
 }
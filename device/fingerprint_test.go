@@ -0,0 +1,108 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/plugins/device"
+	"github.com/hashicorp/nomad/plugins/shared/structs"
+)
+
+func TestDiffFingerprintDetectedRemovedHealthChange(t *testing.T) {
+	previous := []*device.Device{
+		{ID: "stays-healthy", Healthy: true},
+		{ID: "flips-unhealthy", Healthy: true},
+		{ID: "disappears", Healthy: true},
+	}
+	current := []*device.Device{
+		{ID: "stays-healthy", Healthy: true},
+		{ID: "flips-unhealthy", Healthy: false},
+		{ID: "new", Healthy: true},
+	}
+
+	resp := diffFingerprint(&fingerprintRequest{Previous: previous}, current, nil)
+
+	if len(resp.Detected) != 1 || resp.Detected[0].ID != "new" {
+		t.Fatalf("Detected = %v, want [new]", resp.Detected)
+	}
+	if len(resp.Removed) != 1 || resp.Removed[0].ID != "disappears" {
+		t.Fatalf("Removed = %v, want [disappears]", resp.Removed)
+	}
+	if len(resp.HealthChanges) != 1 || resp.HealthChanges[0].ID != "flips-unhealthy" {
+		t.Fatalf("HealthChanges = %v, want [flips-unhealthy]", resp.HealthChanges)
+	}
+	if len(resp.Reclassified) != 0 {
+		t.Fatalf("Reclassified = %v, want none", resp.Reclassified)
+	}
+	if resp.empty() {
+		t.Fatalf("empty() = true, want false given a non-empty diff")
+	}
+}
+
+func TestDiffFingerprintReclassified(t *testing.T) {
+	previous := []*device.Device{{ID: "ABC123", Healthy: true}}
+	current := []*device.Device{{ID: "ABC123", Healthy: true}}
+
+	req := &fingerprintRequest{
+		Previous:           previous,
+		PreviousIdentities: map[string]deviceIdentity{"ABC123": {groupName: "model-1", attributeSignature: "a"}},
+	}
+	identities := map[string]deviceIdentity{"ABC123": {groupName: "model-2", attributeSignature: "a"}}
+
+	resp := diffFingerprint(req, current, identities)
+
+	if len(resp.Reclassified) != 1 || resp.Reclassified[0].ID != "ABC123" {
+		t.Fatalf("Reclassified = %v, want [ABC123]", resp.Reclassified)
+	}
+	if len(resp.Detected) != 0 || len(resp.Removed) != 0 || len(resp.HealthChanges) != 0 {
+		t.Fatalf("expected only a reclassification, got %+v", resp)
+	}
+}
+
+func TestDiffFingerprintNoChangeIsEmpty(t *testing.T) {
+	devices := []*device.Device{{ID: "ABC123", Healthy: true}}
+	identities := map[string]deviceIdentity{"ABC123": {groupName: "model", attributeSignature: "a"}}
+
+	req := &fingerprintRequest{Previous: devices, PreviousIdentities: identities}
+	resp := diffFingerprint(req, devices, identities)
+
+	if !resp.empty() {
+		t.Fatalf("expected no diff for an unchanged snapshot, got %+v", resp)
+	}
+}
+
+func TestAddToVariantGroupsByAttributeSignature(t *testing.T) {
+	matching := map[string]*structs.Attribute{"pixel_format": structs.NewStringAttribute("Mono8")}
+	divergent := map[string]*structs.Attribute{"pixel_format": structs.NewStringAttribute("Mono16")}
+
+	a := &trackedDevice{fingerprintedDevice: fingerprintedDevice{serial_nbr: "a", model: "cam"}, attributes: matching}
+	b := &trackedDevice{fingerprintedDevice: fingerprintedDevice{serial_nbr: "b", model: "cam"}, attributes: matching}
+	c := &trackedDevice{fingerprintedDevice: fingerprintedDevice{serial_nbr: "c", model: "cam"}, attributes: divergent}
+
+	var variants []*deviceVariant
+	variants = addToVariant(variants, a)
+	variants = addToVariant(variants, b)
+	variants = addToVariant(variants, c)
+
+	if len(variants) != 2 {
+		t.Fatalf("got %d variants, want 2 (one for matching signature, one for divergent)", len(variants))
+	}
+
+	var matchingVariant *deviceVariant
+	for _, v := range variants {
+		if len(v.devices) == 2 {
+			matchingVariant = v
+		}
+	}
+	if matchingVariant == nil {
+		t.Fatalf("expected a and b to land in the same variant, got %+v", variants)
+	}
+}
+
+func TestSignatureSuffixStableAndDistinct(t *testing.T) {
+	if signatureSuffix("sig-a") != signatureSuffix("sig-a") {
+		t.Fatalf("signatureSuffix is not deterministic for the same input")
+	}
+	if signatureSuffix("sig-a") == signatureSuffix("sig-b") {
+		t.Fatalf("signatureSuffix collided for distinct inputs")
+	}
+}
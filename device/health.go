@@ -0,0 +1,158 @@
+package device
+
+import (
+	"github.com/hashicorp/nomad/plugins/shared/structs"
+
+	aravis "github.com/Standard-Cognition/genicam-device-plugin/aravis"
+)
+
+const (
+	// healthMissingCycleLimit is how many consecutive fingerprint cycles a
+	// previously-seen device may fail to show up in the discovered list
+	// before we report it as unhealthy rather than assuming a transient
+	// blip.
+	healthMissingCycleLimit = 3
+
+	// healthForgetCycleLimit is how many consecutive missing cycles we'll
+	// tolerate before giving up on a device entirely, closing its control
+	// connection and dropping it from d.devices.
+	healthForgetCycleLimit = 30
+
+	// healthProbeFeature is the GenICam node read on every fingerprint cycle
+	// to confirm a device's control channel is actually responsive, rather
+	// than just trusting that it still appears in the aravis device list.
+	healthProbeFeature = "DeviceVendorName"
+)
+
+// trackedDevice is what GenicamDevice.devices stores per serial number: the
+// last fingerprinted attributes for the device plus its health state.
+type trackedDevice struct {
+	fingerprintedDevice
+
+	healthy       bool
+	missingCycles int
+
+	// attributes are the GenICam feature values reported for this device's
+	// device.DeviceGroup (see attributes.go). nil until the first
+	// readAttributes call.
+	attributes map[string]*structs.Attribute
+
+	// groupName is the DeviceGroup name writeFingerprintToChannel most
+	// recently computed for this device (the model, or, when the model has
+	// several attribute variants, the model plus a signatureSuffix hash --
+	// see writeFingerprintToChannel). writeStatsToChannel reuses it so stats
+	// groups line up with the fingerprinted groups Nomad already knows about.
+	groupName string
+
+	// handle is the open control connection used for health probing,
+	// control-lost notification, and stats polling. It's nil if we couldn't
+	// open the device, or if its control connection was lost; either way,
+	// writeFingerprintToChannel retries the open the next time the device
+	// is seen.
+	handle      *aravis.ArvDeviceHandle
+	controlLost <-chan struct{}
+}
+
+// trackDevice starts tracking a newly discovered device and attempts to
+// open a control connection to it. The device starts out healthy; the
+// caller is expected to immediately confirm that with probeHealth.
+func (d *GenicamDevice) trackDevice(fd *fingerprintedDevice, dev *aravis.ArvDevice) *trackedDevice {
+	tracked := &trackedDevice{
+		fingerprintedDevice: *fd,
+		healthy:             true,
+	}
+
+	d.attachControlConnection(tracked, dev)
+
+	return tracked
+}
+
+// attachControlConnection opens a control connection to dev and starts
+// watching it for control-lost, storing the result on tracked. It's used
+// both to open a newly discovered device's connection and to reattach a
+// known device whose handle went away (failed open, or a prior
+// control-lost) and has reappeared in the discovered list.
+func (d *GenicamDevice) attachControlConnection(tracked *trackedDevice, dev *aravis.ArvDevice) {
+	handle, err := dev.Open()
+	if err != nil {
+		d.logger.Warn("failed to open control connection", "serial_nbr", tracked.serial_nbr, "error", err)
+		return
+	}
+
+	tracked.handle = handle
+	tracked.controlLost = handle.WatchControlLost()
+	go d.watchControlLost(tracked.serial_nbr, tracked.controlLost, handle.Closed())
+}
+
+// probeHealth confirms a tracked device's control channel is still
+// responsive by reading a cheap, always-present feature node.
+func (d *GenicamDevice) probeHealth(tracked *trackedDevice) bool {
+	if tracked.handle == nil {
+		return false
+	}
+
+	if _, err := tracked.handle.GetStringFeatureValue(healthProbeFeature); err != nil {
+		d.logger.Warn("device failed health probe", "serial_nbr", tracked.serial_nbr, "error", err)
+		return false
+	}
+
+	return true
+}
+
+// watchControlLost blocks until the device's "control-lost" signal fires and
+// flips the device unhealthy, waking up doFingerprint so the change goes out
+// right away instead of waiting for the next poll. It also returns, without
+// touching the device, once closed fires -- that means the handle it was
+// watching has been closed out from under it (e.g. the device was forgotten
+// or reattached), so there's nothing left to watch.
+func (d *GenicamDevice) watchControlLost(serial_nbr string, controlLost, closed <-chan struct{}) {
+	select {
+	case <-controlLost:
+	case <-closed:
+		return
+	}
+
+	d.deviceLock.Lock()
+	tracked, ok := d.devices[serial_nbr]
+	changed := ok && tracked.healthy
+	if ok {
+		tracked.healthy = false
+		if tracked.handle != nil {
+			tracked.handle.Close()
+			tracked.handle = nil
+		}
+	}
+	if changed {
+		d.logger.Warn("camera control connection lost", "serial_nbr", serial_nbr)
+	}
+	d.deviceLock.Unlock()
+
+	if changed {
+		d.signalHealthChange()
+	}
+}
+
+// forgetDevice releases a device's control connection and drops it from
+// tracking entirely. Called once a device has been missing long enough that
+// it's no longer worth holding onto health state for it.
+func (d *GenicamDevice) forgetDevice(serial_nbr string) {
+	tracked, ok := d.devices[serial_nbr]
+	if !ok {
+		return
+	}
+
+	if tracked.handle != nil {
+		tracked.handle.Close()
+	}
+
+	delete(d.devices, serial_nbr)
+}
+
+// signalHealthChange wakes up doFingerprint so it emits an updated
+// FingerprintResponse immediately instead of waiting for the next poll.
+func (d *GenicamDevice) signalHealthChange() {
+	select {
+	case d.healthEvents <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,55 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pseudoDeviceSeparator joins a physical camera's serial number to its
+// pseudo-device index, e.g. "ABC123#0".
+const pseudoDeviceSeparator = "#"
+
+// resolvedDeviceID is a device ID passed to Reserve, decoded back into the
+// physical camera it came from.
+type resolvedDeviceID struct {
+	id          string
+	serial_nbr  string
+	pseudoIndex int
+}
+
+// parsePseudoDeviceID splits a device ID into its physical serial number and
+// pseudo-device index. IDs without a separator -- the common case when
+// num_pseudo_devices is 1 -- are treated as index 0 of that serial number,
+// so exclusive-mode job specs that reference a bare serial number keep
+// working unchanged.
+func parsePseudoDeviceID(id string) (serial_nbr string, pseudoIndex int, err error) {
+	parts := strings.SplitN(id, pseudoDeviceSeparator, 2)
+	if len(parts) == 1 {
+		return parts[0], 0, nil
+	}
+
+	pseudoIndex, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid pseudo device id %q: %w", id, err)
+	}
+
+	return parts[0], pseudoIndex, nil
+}
+
+// pseudoDeviceIDs returns the device IDs fingerprinting should report for a
+// physical camera, given how many pseudo devices it's split into. A count
+// of 1 (exclusive mode, the default) reports the bare serial number so
+// existing job specs aren't affected.
+func pseudoDeviceIDs(serial_nbr string, count int) []string {
+	if count <= 1 {
+		return []string{serial_nbr}
+	}
+
+	ids := make([]string, count)
+	for i := 0; i < count; i++ {
+		ids[i] = fmt.Sprintf("%s%s%d", serial_nbr, pseudoDeviceSeparator, i)
+	}
+
+	return ids
+}
@@ -0,0 +1,81 @@
+package device
+
+import "testing"
+
+func TestParsePseudoDeviceID(t *testing.T) {
+	cases := []struct {
+		name            string
+		id              string
+		wantSerialNbr   string
+		wantPseudoIndex int
+		wantErr         bool
+	}{
+		{name: "bare serial", id: "ABC123", wantSerialNbr: "ABC123", wantPseudoIndex: 0},
+		{name: "pseudo index 0", id: "ABC123#0", wantSerialNbr: "ABC123", wantPseudoIndex: 0},
+		{name: "pseudo index 3", id: "ABC123#3", wantSerialNbr: "ABC123", wantPseudoIndex: 3},
+		{name: "invalid index", id: "ABC123#x", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			serialNbr, pseudoIndex, err := parsePseudoDeviceID(c.id)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parsePseudoDeviceID(%q) = nil error, want error", c.id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePseudoDeviceID(%q) returned unexpected error: %v", c.id, err)
+			}
+			if serialNbr != c.wantSerialNbr || pseudoIndex != c.wantPseudoIndex {
+				t.Fatalf("parsePseudoDeviceID(%q) = (%q, %d), want (%q, %d)",
+					c.id, serialNbr, pseudoIndex, c.wantSerialNbr, c.wantPseudoIndex)
+			}
+		})
+	}
+}
+
+func TestPseudoDeviceIDs(t *testing.T) {
+	cases := []struct {
+		name      string
+		serialNbr string
+		count     int
+		wantIDs   []string
+	}{
+		{name: "exclusive mode", serialNbr: "ABC123", count: 1, wantIDs: []string{"ABC123"}},
+		{name: "count zero treated as exclusive", serialNbr: "ABC123", count: 0, wantIDs: []string{"ABC123"}},
+		{name: "shared mode", serialNbr: "ABC123", count: 3, wantIDs: []string{"ABC123#0", "ABC123#1", "ABC123#2"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := pseudoDeviceIDs(c.serialNbr, c.count)
+			if len(got) != len(c.wantIDs) {
+				t.Fatalf("pseudoDeviceIDs(%q, %d) = %v, want %v", c.serialNbr, c.count, got, c.wantIDs)
+			}
+			for i := range got {
+				if got[i] != c.wantIDs[i] {
+					t.Fatalf("pseudoDeviceIDs(%q, %d) = %v, want %v", c.serialNbr, c.count, got, c.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+// TestPseudoDeviceIDRoundTrip pins the property the chunk0-3 reservation fix
+// depends on: every ID pseudoDeviceIDs hands out for a camera parses back to
+// that same serial number, distinguished only by pseudo index.
+func TestPseudoDeviceIDRoundTrip(t *testing.T) {
+	for _, count := range []int{1, 2, 4} {
+		for _, id := range pseudoDeviceIDs("ABC123", count) {
+			serialNbr, _, err := parsePseudoDeviceID(id)
+			if err != nil {
+				t.Fatalf("parsePseudoDeviceID(%q) returned unexpected error: %v", id, err)
+			}
+			if serialNbr != "ABC123" {
+				t.Fatalf("parsePseudoDeviceID(%q) serial = %q, want %q", id, serialNbr, "ABC123")
+			}
+		}
+	}
+}
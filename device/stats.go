@@ -0,0 +1,225 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/nomad/plugins/device"
+
+	aravis "github.com/Standard-Cognition/genicam-device-plugin/aravis"
+)
+
+const (
+	// statsBackoffBaseline is how long we wait before retrying feature reads
+	// on a camera right after the first failure.
+	statsBackoffBaseline = 5 * time.Second
+
+	// statsBackoffCap is the maximum backoff applied to a single camera, so a
+	// camera that's been unreachable for a while doesn't take forever to
+	// notice it's back.
+	statsBackoffCap = 30 * time.Minute
+)
+
+// statsBackoff tracks per-device exponential backoff so a single flaky
+// camera can't make doStats hot-loop the whole plugin.
+type statsBackoff struct {
+	next     time.Time
+	duration time.Duration
+}
+
+// ready reports whether it's time to retry this device.
+func (b *statsBackoff) ready() bool {
+	return time.Now().After(b.next)
+}
+
+// recordSuccess clears any accumulated backoff.
+func (b *statsBackoff) recordSuccess() {
+	b.duration = 0
+	b.next = time.Time{}
+}
+
+// recordFailure doubles the backoff (starting at statsBackoffBaseline),
+// capped at statsBackoffCap.
+func (b *statsBackoff) recordFailure() {
+	if b.duration == 0 {
+		b.duration = statsBackoffBaseline
+	} else if b.duration < statsBackoffCap {
+		b.duration *= 2
+		if b.duration > statsBackoffCap {
+			b.duration = statsBackoffCap
+		}
+	}
+	b.next = time.Now().Add(b.duration)
+}
+
+// doStats is the long-running goroutine that periodically polls GenICam
+// feature nodes on every fingerprinted camera and emits device.StatsResponse
+// messages grouped the same way as fingerprinting.
+func (d *GenicamDevice) doStats(ctx context.Context, stats chan<- *device.StatsResponse, interval time.Duration) {
+	defer close(stats)
+
+	// per-device backoff state, keyed by serial number
+	backoffs := make(map[string]*statsBackoff)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.writeStatsToChannel(ctx, stats, backoffs)
+	}
+}
+
+// writeStatsToChannel polls every currently fingerprint-tracked camera for
+// stats over its existing control connection, grouping the results by the
+// same device-group name writeFingerprintToChannel assigned it (see
+// trackedDevice.groupName), and sends a response if at least one camera
+// answered. It reads the candidate list from d.devices rather than calling
+// aravis.GetDevices itself -- the fingerprint goroutine already owns
+// enumerating and mutating aravis' process-global device list, and having
+// both goroutines call into it concurrently is a data race.
+func (d *GenicamDevice) writeStatsToChannel(ctx context.Context, stats chan<- *device.StatsResponse, backoffs map[string]*statsBackoff) {
+	d.deviceLock.RLock()
+	serialNbrs := make([]string, 0, len(d.devices))
+	for serial_nbr := range d.devices {
+		serialNbrs = append(serialNbrs, serial_nbr)
+	}
+	d.deviceLock.RUnlock()
+
+	groupStats := make(map[string]*device.DeviceGroupStats)
+
+	for _, serial_nbr := range serialNbrs {
+		b, ok := backoffs[serial_nbr]
+		if !ok {
+			b = &statsBackoff{}
+			backoffs[serial_nbr] = b
+		}
+		if !b.ready() {
+			continue
+		}
+
+		deviceStats, groupName, polled, err := d.pollTrackedDeviceStats(serial_nbr)
+		if !polled {
+			// fingerprinting owns opening (and reattaching) control
+			// connections; GigE Vision only allows one, so there's nothing
+			// safe for stats to poll with until fingerprinting has one open.
+			continue
+		}
+		if err != nil {
+			b.recordFailure()
+			d.logger.Warn("failed to poll device stats, backing off", "serial_nbr", serial_nbr, "error", err, "backoff", b.duration)
+			continue
+		}
+		b.recordSuccess()
+
+		group, ok := groupStats[groupName]
+		if !ok {
+			group = &device.DeviceGroupStats{
+				Vendor:        vendor,
+				Type:          deviceType,
+				Name:          groupName,
+				InstanceStats: map[string]*device.DeviceStats{},
+			}
+			groupStats[groupName] = group
+		}
+		group.InstanceStats[serial_nbr] = deviceStats
+	}
+
+	if len(groupStats) == 0 {
+		return
+	}
+
+	groups := make([]*device.DeviceGroupStats, 0, len(groupStats))
+	for _, group := range groupStats {
+		groups = append(groups, group)
+	}
+
+	select {
+	case stats <- &device.StatsResponse{Groups: groups}:
+	case <-ctx.Done():
+	}
+}
+
+// pollTrackedDeviceStats looks up the tracked device for serial_nbr and, if
+// it has a live control connection, polls its stats. The poll runs with
+// deviceLock held for its duration (not just the lookup), so a concurrent
+// watchControlLost or forgetDevice can't close the handle out from under an
+// in-flight read -- that would free the underlying aravis device while we're
+// still using it. polled is false if there's no tracked handle to poll.
+func (d *GenicamDevice) pollTrackedDeviceStats(serial_nbr string) (deviceStats *device.DeviceStats, groupName string, polled bool, err error) {
+	d.deviceLock.RLock()
+	defer d.deviceLock.RUnlock()
+
+	tracked, known := d.devices[serial_nbr]
+	if !known || tracked.handle == nil {
+		return nil, "", false, nil
+	}
+
+	deviceStats, err = pollDeviceStats(tracked.handle)
+	return deviceStats, tracked.groupName, true, err
+}
+
+// pollDeviceStats reads the standard GenICam nodes we report as stats over
+// handle, an already-open control connection owned by the device's
+// trackedDevice. It returns an error if none of the nodes could be read, so
+// the caller can back off the device.
+func pollDeviceStats(handle *aravis.ArvDeviceHandle) (*device.DeviceStats, error) {
+	attrs := map[string]*device.StatValue{}
+
+	if temperature, err := handle.GetFloatFeatureValue("DeviceTemperature"); err == nil {
+		attrs["device_temperature"] = floatGaugeStat(temperature, "C", "current sensor temperature reported by the camera")
+	}
+
+	if uptime, err := handle.GetIntegerFeatureValue("DeviceUptime"); err == nil {
+		attrs["device_uptime"] = intGaugeStat(uptime, "ms", "time since the device was powered on")
+	}
+
+	if frameRate, err := handle.GetFloatFeatureValue("AcquisitionFrameRate"); err == nil {
+		attrs["acquisition_frame_rate"] = floatGaugeStat(frameRate, "Hz", "current acquisition frame rate")
+	}
+
+	if resendCount, err := handle.GetIntegerFeatureValue("GevStreamChannelPacketResendCount"); err == nil {
+		attrs["packet_resend_count"] = intGaugeStat(resendCount, "packets", "cumulative count of GigE Vision packets that had to be resent")
+	}
+
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("no stat features could be read")
+	}
+
+	summary := map[string]*device.StatValue{}
+	if temperature, ok := attrs["device_temperature"]; ok {
+		summary["device_temperature"] = temperature
+	}
+
+	return &device.DeviceStats{
+		Summary:   &device.StatObject{Attributes: summary},
+		Stats:     &device.StatObject{Attributes: attrs},
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// floatGaugeStat builds a StatValue for an instantaneous float reading.
+func floatGaugeStat(v float64, unit, desc string) *device.StatValue {
+	return &device.StatValue{
+		FloatNumeratorVal: &v,
+		Unit:              unit,
+		Desc:              desc,
+	}
+}
+
+// intGaugeStat builds a StatValue for an integer reading, instantaneous or
+// cumulative -- device.StatValue has no separate counter representation, so
+// callers distinguish the two in desc (see the resend-count stat above).
+func intGaugeStat(v int64, unit, desc string) *device.StatValue {
+	return &device.StatValue{
+		IntNumeratorVal: &v,
+		Unit:            unit,
+		Desc:            desc,
+	}
+}